@@ -0,0 +1,103 @@
+package main
+
+//
+// start the coordinator process, which is implemented in ../mr/coordinator.go
+//
+// go run mrcoordinator.go pg-*.txt
+//
+// To run a fault-tolerant, raft-backed group of three replicas instead of
+// a single node, start each with its own --raft-id and the same
+// --raft-peers list, e.g. on replica 1:
+//
+//   go run mrcoordinator.go --raft-id 1 \
+//     --raft-peers 0=:9001,1=:9002,2=:9003 pg-*.txt
+//
+// and point workers at every replica's client socket via
+// MR_COORDINATOR_SOCKS (see mr/rpc.go).
+//
+// For locality-aware Map scheduling, pass --split-locations with a
+// comma-separated file=host list saying which worker host each input
+// file's data is local to, e.g.:
+//
+//   go run mrcoordinator.go --split-locations pg-0.txt=worker1,pg-1.txt=worker2 pg-*.txt
+//
+// Workers report their own host at Register time (see mr/worker.go), so
+// this only pays off when that matches an entry here.
+//
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"6.824/mr"
+)
+
+func main() {
+	backupThreshold := flag.Duration("backup-threshold", 10*time.Second,
+		"how long a task may run before a backup copy is dispatched to another worker")
+	nReduce := flag.Int("reduce", 10, "number of reduce tasks")
+	splitSize := flag.Int64("split-size", 16*1024*1024, "max bytes of an input file one Map task is given")
+	raftId := flag.Int("raft-id", -1, "this replica's id in --raft-peers; omit for a single-node coordinator")
+	raftPeers := flag.String("raft-peers", "", "comma-separated id=address list of every raft replica")
+	splitLocationsFlag := flag.String("split-locations", "",
+		"comma-separated file=host list saying which worker host each input file is local to")
+	flag.Parse()
+
+	files := flag.Args()
+	if len(files) < 1 {
+		panic("Usage: mrcoordinator inputfiles...")
+	}
+
+	mr.BackupThreshold = *backupThreshold
+	mr.DefaultSplitSize = *splitSize
+	splitLocations := parseSplitLocations(*splitLocationsFlag)
+
+	var m *mr.Coordinator
+	if *raftId >= 0 {
+		peers := parseRaftPeers(*raftPeers)
+		clientSock := fmt.Sprintf("%s-%d", mr.CoordinatorSockPrefix(), *raftId)
+		store := mr.NewRaftStateStore(*raftId, peers, clientSock+".raft")
+		m = mr.MakeCoordinatorWithStore(files, *nReduce, splitLocations, store, clientSock)
+	} else {
+		m = mr.MakeCoordinatorWithLocations(files, *nReduce, splitLocations)
+	}
+
+	for m.Done() == false {
+		time.Sleep(time.Second)
+	}
+	time.Sleep(time.Second)
+}
+
+func parseRaftPeers(spec string) []mr.RaftPeer {
+	var peers []mr.RaftPeer
+	for _, entry := range strings.Split(spec, ",") {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			panic("bad --raft-peers entry: " + entry)
+		}
+		id, err := strconv.Atoi(parts[0])
+		if err != nil {
+			panic("bad --raft-peers id: " + entry)
+		}
+		peers = append(peers, mr.RaftPeer{Id: id, Address: parts[1]})
+	}
+	return peers
+}
+
+func parseSplitLocations(spec string) map[string]string {
+	if spec == "" {
+		return nil
+	}
+	locations := make(map[string]string)
+	for _, entry := range strings.Split(spec, ",") {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			panic("bad --split-locations entry: " + entry)
+		}
+		locations[parts[0]] = parts[1]
+	}
+	return locations
+}
@@ -0,0 +1,101 @@
+package main
+
+//
+// start a worker process, which is implemented in ../mr/worker.go. typically
+// there will be multiple worker processes, talking to one coordinator.
+//
+// go run mrworker.go wc.so
+//
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"plugin"
+
+	"6.824/mr"
+)
+
+func main() {
+	codecName := flag.String("codec", "json",
+		"intermediate file format: json, gob, or sorted (sorted enables merge-based reduce). "+
+			"Must match every other worker in the job.")
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: mrworker [--codec json|gob|sorted] xxx.so\n")
+		os.Exit(1)
+	}
+
+	codec, err := mr.CodecByName(*codecName)
+	if err != nil {
+		log.Fatalf("--codec: %v", err)
+	}
+	mr.IntermediateCodec = codec
+
+	mapF, reduceF := loadPlugin(flag.Arg(0))
+	combineF := loadCombine(flag.Arg(0))
+	mapStreamF := loadMapStream(flag.Arg(0))
+
+	mr.Worker(mapF, reduceF, combineF, mapStreamF)
+}
+
+// load the application Map and Reduce functions from a plugin file, e.g.
+// ../mrapps/wc.so
+func loadPlugin(filename string) (func(string, string) []mr.KeyValue, func(string, []string) string) {
+	p, err := plugin.Open(filename)
+	if err != nil {
+		log.Fatalf("cannot load plugin %v", filename)
+	}
+	xmapf, err := p.Lookup("Map")
+	if err != nil {
+		log.Fatalf("cannot find Map in %v", filename)
+	}
+	mapF := xmapf.(func(string, string) []mr.KeyValue)
+	xreducef, err := p.Lookup("Reduce")
+	if err != nil {
+		log.Fatalf("cannot find Reduce in %v", filename)
+	}
+	reduceF := xreducef.(func(string, []string) string)
+
+	return mapF, reduceF
+}
+
+// load the application's optional Combine function from the same plugin.
+// apps that don't export a Combine symbol fall back to no in-map
+// aggregation, so existing apps keep working unmodified.
+func loadCombine(filename string) func(string, []string) string {
+	p, err := plugin.Open(filename)
+	if err != nil {
+		log.Fatalf("cannot load plugin %v", filename)
+	}
+	xcombinef, err := p.Lookup("Combine")
+	if err != nil {
+		return nil
+	}
+	combineF, ok := xcombinef.(func(string, []string) string)
+	if !ok {
+		return nil
+	}
+	return combineF
+}
+
+// load the application's optional MapStream function from the same
+// plugin. Apps that don't export one fall back to the classic whole-split
+// Map function.
+func loadMapStream(filename string) mr.MapStream {
+	p, err := plugin.Open(filename)
+	if err != nil {
+		log.Fatalf("cannot load plugin %v", filename)
+	}
+	xmapstreamf, err := p.Lookup("MapStream")
+	if err != nil {
+		return nil
+	}
+	mapStreamF, ok := xmapstreamf.(func(string, <-chan string, func(mr.KeyValue)))
+	if !ok {
+		return nil
+	}
+	return mr.MapStream(mapStreamF)
+}
@@ -0,0 +1,271 @@
+package mr
+
+import (
+	"bytes"
+	"container/heap"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// IntermediateCodec selects how doMapTask writes and doReduceTask reads the
+// mr-X-Y intermediate files. Swap it before calling Worker to change format;
+// JSONCodec keeps today's on-disk layout. main/mrworker.go exposes this as
+// a --codec flag; every worker in a job must be started with the same
+// value, since one worker's Map output is read by another's Reduce.
+var IntermediateCodec Codec = JSONCodec{}
+
+// CodecByName looks up a Codec by the name used on the --codec flag.
+func CodecByName(name string) (Codec, error) {
+	switch name {
+	case "json":
+		return JSONCodec{}, nil
+	case "gob":
+		return GobCodec{}, nil
+	case "sorted":
+		return SortedCodec{}, nil
+	default:
+		return nil, fmt.Errorf("unknown codec %q (want json, gob, or sorted)", name)
+	}
+}
+
+// Codec turns a slice of KeyValue pairs into bytes and back, so the
+// intermediate file format can be changed without touching doMapTask or
+// doReduceTask's task-execution logic.
+type Codec interface {
+	Encode(w io.Writer, kva []KeyValue) error
+	Decode(r io.Reader) ([]KeyValue, error)
+}
+
+// JSONCodec is the original one-JSON-object-per-record format.
+type JSONCodec struct{}
+
+func (JSONCodec) Encode(w io.Writer, kva []KeyValue) error {
+	enc := json.NewEncoder(w)
+	for _, kv := range kva {
+		if err := enc.Encode(&kv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (JSONCodec) Decode(r io.Reader) ([]KeyValue, error) {
+	var kva []KeyValue
+	dec := json.NewDecoder(r)
+	for {
+		var kv KeyValue
+		if err := dec.Decode(&kv); err != nil {
+			break
+		}
+		kva = append(kva, kv)
+	}
+	return kva, nil
+}
+
+// GobCodec stores each KeyValue as a length-prefixed gob blob. Gob is
+// cheaper to encode/decode than JSON and doesn't pay JSON's per-field
+// name/quoting overhead, which matters once the shuffle gets large.
+type GobCodec struct{}
+
+func (GobCodec) Encode(w io.Writer, kva []KeyValue) error {
+	for _, kv := range kva {
+		if err := encodeGobRecord(w, &kv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (GobCodec) Decode(r io.Reader) ([]KeyValue, error) {
+	var kva []KeyValue
+	for {
+		kv, err := decodeGobRecord(r)
+		if err != nil {
+			break
+		}
+		kva = append(kva, *kv)
+	}
+	return kva, nil
+}
+
+func encodeGobRecord(w io.Writer, kv *KeyValue) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(kv); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.BigEndian, uint32(buf.Len())); err != nil {
+		return err
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func decodeGobRecord(r io.Reader) (*KeyValue, error) {
+	var length uint32
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	var kv KeyValue
+	if err := gob.NewDecoder(bytes.NewReader(buf)).Decode(&kv); err != nil {
+		return nil, err
+	}
+	return &kv, nil
+}
+
+// SortedCodec stores KeyValue pairs sorted by key, each length-prefixed
+// like GobCodec, followed by a gob-encoded index of (key, offset) pairs and
+// an 8-byte footer pointing at the index. The index isn't consulted by
+// doReduceTask today (it merge-streams records in order instead), but it's
+// there so a future point lookup doesn't need a full scan.
+type SortedCodec struct{}
+
+type sortedIndexEntry struct {
+	Key    string
+	Offset int64
+}
+
+func (SortedCodec) Encode(w io.Writer, kva []KeyValue) error {
+	sorted := append([]KeyValue(nil), kva...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Key < sorted[j].Key })
+
+	cw := &countingWriter{w: w}
+	index := make([]sortedIndexEntry, 0, len(sorted))
+	for _, kv := range sorted {
+		index = append(index, sortedIndexEntry{Key: kv.Key, Offset: cw.n})
+		if err := encodeGobRecord(cw, &kv); err != nil {
+			return err
+		}
+	}
+
+	indexOffset := cw.n
+	if err := gob.NewEncoder(cw).Encode(index); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.BigEndian, indexOffset)
+}
+
+func (SortedCodec) Decode(r io.Reader) ([]KeyValue, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 8 {
+		return nil, fmt.Errorf("sorted codec: truncated file")
+	}
+	indexOffset := int64(binary.BigEndian.Uint64(data[len(data)-8:]))
+	return decodeSortedRecords(bytes.NewReader(data[:indexOffset]))
+}
+
+func decodeSortedRecords(r io.Reader) ([]KeyValue, error) {
+	var kva []KeyValue
+	for {
+		kv, err := decodeGobRecord(r)
+		if err != nil {
+			break
+		}
+		kva = append(kva, *kv)
+	}
+	return kva, nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// SortedStreamReader streams records out of a SortedCodec file in key
+// order, one at a time. doReduceTask uses one per map output so it can
+// k-way merge the M partitions instead of loading them all into memory.
+type SortedStreamReader struct {
+	r io.Reader
+}
+
+// OpenSortedStream reads f's footer to find where the trailing index
+// begins and returns a reader limited to the record section in front of it.
+func OpenSortedStream(f *os.File) (*SortedStreamReader, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	footer := make([]byte, 8)
+	if _, err := f.ReadAt(footer, info.Size()-8); err != nil {
+		return nil, err
+	}
+	indexOffset := int64(binary.BigEndian.Uint64(footer))
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return &SortedStreamReader{r: io.LimitReader(f, indexOffset)}, nil
+}
+
+// Next returns the next record in key order, or io.EOF once the record
+// section is exhausted.
+func (s *SortedStreamReader) Next() (*KeyValue, error) {
+	kv, err := decodeGobRecord(s.r)
+	if err != nil {
+		return nil, io.EOF
+	}
+	return kv, nil
+}
+
+// mergeItem is one entry in the reduce-side k-way merge heap: the
+// lowest-not-yet-consumed KeyValue from one map output's sorted stream.
+type mergeItem struct {
+	kv     *KeyValue
+	stream *SortedStreamReader
+}
+
+type mergeHeap []*mergeItem
+
+func (h mergeHeap) Len() int            { return len(h) }
+func (h mergeHeap) Less(i, j int) bool  { return h[i].kv.Key < h[j].kv.Key }
+func (h mergeHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *mergeHeap) Push(x interface{}) { *h = append(*h, x.(*mergeItem)) }
+func (h *mergeHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+// mergeReduceInputs k-way merges nMap sorted streams and invokes visit once
+// per distinct key with all of its values grouped together, in key order.
+func mergeReduceInputs(streams []*SortedStreamReader, visit func(key string, values []string)) {
+	h := &mergeHeap{}
+	heap.Init(h)
+	for _, stream := range streams {
+		if kv, err := stream.Next(); err == nil {
+			heap.Push(h, &mergeItem{kv: kv, stream: stream})
+		}
+	}
+
+	for h.Len() > 0 {
+		key := (*h)[0].kv.Key
+		var values []string
+		for h.Len() > 0 && (*h)[0].kv.Key == key {
+			item := heap.Pop(h).(*mergeItem)
+			values = append(values, item.kv.Value)
+			if next, err := item.stream.Next(); err == nil {
+				item.kv = next
+				heap.Push(h, item)
+			}
+		}
+		visit(key, values)
+	}
+}
@@ -0,0 +1,106 @@
+package mr
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestCodecByName(t *testing.T) {
+	cases := map[string]Codec{
+		"json":   JSONCodec{},
+		"gob":    GobCodec{},
+		"sorted": SortedCodec{},
+	}
+	for name, want := range cases {
+		got, err := CodecByName(name)
+		if err != nil {
+			t.Fatalf("CodecByName(%q): %v", name, err)
+		}
+		if got != want {
+			t.Fatalf("CodecByName(%q) = %#v, want %#v", name, got, want)
+		}
+	}
+	if _, err := CodecByName("xml"); err == nil {
+		t.Fatalf("CodecByName(\"xml\") should have errored")
+	}
+}
+
+func roundtrip(t *testing.T, codec Codec, kva []KeyValue) []KeyValue {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := codec.Encode(&buf, kva); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	got, err := codec.Decode(&buf)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	return got
+}
+
+func TestCodecsRoundTrip(t *testing.T) {
+	kva := []KeyValue{{Key: "b", Value: "2"}, {Key: "a", Value: "1"}, {Key: "c", Value: "3"}}
+	for name, codec := range map[string]Codec{"json": JSONCodec{}, "gob": GobCodec{}, "sorted": SortedCodec{}} {
+		got := roundtrip(t, codec, kva)
+		sortedGot := append([]KeyValue(nil), got...)
+		sort.Slice(sortedGot, func(i, j int) bool { return sortedGot[i].Key < sortedGot[j].Key })
+		sortedWant := append([]KeyValue(nil), kva...)
+		sort.Slice(sortedWant, func(i, j int) bool { return sortedWant[i].Key < sortedWant[j].Key })
+		if len(sortedGot) != len(sortedWant) {
+			t.Fatalf("%s: got %v, want %v", name, sortedGot, sortedWant)
+		}
+		for i := range sortedGot {
+			if sortedGot[i] != sortedWant[i] {
+				t.Fatalf("%s: got %v, want %v", name, sortedGot, sortedWant)
+			}
+		}
+	}
+}
+
+func TestMergeReduceInputsKWayMerge(t *testing.T) {
+	dir := t.TempDir()
+	inputs := [][]KeyValue{
+		{{Key: "a", Value: "1"}, {Key: "c", Value: "3"}},
+		{{Key: "a", Value: "4"}, {Key: "b", Value: "2"}},
+	}
+
+	var streams []*SortedStreamReader
+	for i, kva := range inputs {
+		path := filepath.Join(dir, filepath.Base(generateMapResultFileName(i, 0)))
+		var buf bytes.Buffer
+		if err := (SortedCodec{}).Encode(&buf, kva); err != nil {
+			t.Fatalf("Encode: %v", err)
+		}
+		if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatalf("Open: %v", err)
+		}
+		defer f.Close()
+		stream, err := OpenSortedStream(f)
+		if err != nil {
+			t.Fatalf("OpenSortedStream: %v", err)
+		}
+		streams = append(streams, stream)
+	}
+
+	got := map[string][]string{}
+	mergeReduceInputs(streams, func(key string, values []string) {
+		got[key] = append([]string(nil), values...)
+	})
+
+	want := map[string]int{"a": 2, "b": 1, "c": 1}
+	for key, count := range want {
+		if len(got[key]) != count {
+			t.Fatalf("key %q: got %v, want %d values", key, got[key], count)
+		}
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got keys %v, want keys %v", got, want)
+	}
+}
@@ -0,0 +1,441 @@
+package mr
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"net/rpc"
+	"os"
+	"sync"
+	"time"
+)
+
+// BackupThreshold is how long a task may run before it's considered a
+// straggler once its phase is mostly done. This mirrors the MapReduce
+// paper's defense against slow machines: rather than wait on one slow
+// worker, hand the same task to a second idle worker and take whichever
+// finishes first. It's a package-level var rather than a MakeCoordinator
+// argument so main/mrcoordinator.go can tune it with a flag without
+// changing the constructor's signature.
+var BackupThreshold = 10 * time.Second
+
+// backupPhaseDoneRatio is how much of the current phase must already be
+// Finished before we start handing out backup copies of the stragglers.
+const backupPhaseDoneRatio = 0.9
+
+// CrashThreshold is how long a task may run before it's reissued no matter
+// how much of the phase is done. backupPhaseDoneRatio alone only covers the
+// paper's near-completion straggler case; a worker that crashes mid-task
+// with a small nMap/nReduce (the common case in this lab) can otherwise
+// leave the job hung forever below that ratio, since findIdleTask never
+// hands out a Working task on its own.
+var CrashThreshold = 60 * time.Second
+
+type TaskStatus int
+
+const (
+	Idle TaskStatus = iota
+	Working
+	Finished
+)
+
+// task tracks one logical piece of work: a byte-range split of an input
+// file in the Map phase, or a reduce partition in the Reduce phase.
+// Because of backup execution, more than one worker attempt may be
+// Working on the same task id at once; attemptId disambiguates which
+// Heartbeat handed out which copy and lets Report tell winners from late
+// stragglers.
+type task struct {
+	fileName    string
+	offset      int64 // Map only: start of this task's split within fileName
+	length      int64 // Map only: length of this task's split
+	id          int
+	status      TaskStatus
+	startTime   time.Time
+	nextAttempt int
+}
+
+// workerInfo is what a worker announces via Register: the host its local
+// input splits live on, and the address its file-fetch RPC server listens
+// on so other workers can pull its map output.
+type workerInfo struct {
+	Host    string
+	Address string
+}
+
+type Coordinator struct {
+	mu sync.Mutex
+
+	files   []string
+	nReduce int
+	nMap    int
+
+	phase SchedulePhase
+	tasks []task
+
+	doneCount int
+
+	workers      map[int]workerInfo
+	nextWorkerId int
+
+	// splitLocations maps an input file name to the host it's local to, so
+	// Map tasks can be preferentially handed to a worker on that host.
+	splitLocations map[string]string
+
+	// mapLocations[i] is the fetch address of the worker that produced
+	// mr-i-*, filled in as Map tasks are Reported. Handed to reducers so
+	// they can pull shards over RPC instead of assuming a shared fs.
+	mapLocations []string
+
+	// store durably records every task-state transition so a crashed or
+	// deposed coordinator can rebuild tasks/doneCount/mapLocations from
+	// scratch instead of losing the job. seen dedupes Reports by the
+	// worker-supplied idempotency key, so a Report replayed from the log
+	// (or retried after a leader change) can't double-count.
+	store StateStore
+	seen  map[string]bool
+}
+
+// MakeCoordinator creates a Coordinator backed by a single-node, fsync-
+// per-write JSON log, with no split locations. main/mrcoordinator.go uses
+// MakeCoordinatorWithLocations or MakeCoordinatorWithStore instead.
+func MakeCoordinator(files []string, nReduce int) *Coordinator {
+	return MakeCoordinatorWithLocations(files, nReduce, nil)
+}
+
+// MakeCoordinatorWithLocations is MakeCoordinator plus a file name -> host
+// map describing where each input split's data lives, enabling GFS-style
+// locality-aware Map scheduling.
+func MakeCoordinatorWithLocations(files []string, nReduce int, splitLocations map[string]string) *Coordinator {
+	return MakeCoordinatorWithStore(files, nReduce, splitLocations, NewJSONLogStore(coordinatorSock()+".log"), coordinatorSock())
+}
+
+// MakeCoordinatorWithStore is the fully general constructor: it rebuilds
+// task state by replaying store before serving any RPCs, which is what
+// lets a restarted coordinator (or a newly elected raft leader) recover
+// mid-job instead of starting over. clientSock is the unix socket workers
+// dial; raft replicas each need their own (see MR_COORDINATOR_SOCKS).
+func MakeCoordinatorWithStore(files []string, nReduce int, splitLocations map[string]string, store StateStore, clientSock string) *Coordinator {
+	tasks, err := buildMapTasks(files, DefaultSplitSize)
+	if err != nil {
+		log.Fatalf("cannot stat input files: %v", err)
+	}
+
+	c := &Coordinator{
+		files:          files,
+		nReduce:        nReduce,
+		nMap:           len(tasks),
+		phase:          MapPhase,
+		tasks:          tasks,
+		workers:        make(map[int]workerInfo),
+		splitLocations: splitLocations,
+		mapLocations:   make([]string, len(tasks)),
+		store:          store,
+		seen:           make(map[string]bool),
+	}
+
+	if err := store.Replay(c.applyEntry); err != nil {
+		log.Fatalf("cannot replay state log: %v", err)
+	}
+	// Any task still Working at the end of replay belongs to an attempt
+	// whose assigning process never got to see it complete; reissue it.
+	for i := range c.tasks {
+		if c.tasks[i].status == Working {
+			c.tasks[i].status = Idle
+		}
+	}
+
+	c.server(clientSock)
+	return c
+}
+
+// applyEntry replays a single StateEntry onto the in-memory task tables.
+// It's the inverse of the mutations assign/Report/advancePhase make, kept
+// in lockstep with them so recovery reaches the exact same state.
+func (c *Coordinator) applyEntry(e StateEntry) {
+	switch e.Type {
+	case EntryAssigned:
+		if e.Phase != c.phase || e.TaskId >= len(c.tasks) {
+			return
+		}
+		t := &c.tasks[e.TaskId]
+		t.status = Working
+		t.startTime = time.Now()
+		if e.AttemptId >= t.nextAttempt {
+			t.nextAttempt = e.AttemptId + 1
+		}
+	case EntryCompleted:
+		c.seen[e.IdempotencyKey] = true
+		if e.Phase != c.phase || e.TaskId >= len(c.tasks) {
+			return
+		}
+		t := &c.tasks[e.TaskId]
+		if t.status != Finished {
+			t.status = Finished
+			c.doneCount++
+			if e.Phase == MapPhase {
+				c.mapLocations[t.id] = c.workers[e.WorkerId].Address
+			}
+		}
+	case EntryPhaseAdvanced:
+		c.advancePhase()
+	case EntryRegistered:
+		c.workers[e.WorkerId] = workerInfo{Host: e.Host, Address: e.Address}
+		if e.WorkerId >= c.nextWorkerId {
+			c.nextWorkerId = e.WorkerId + 1
+		}
+	}
+}
+
+// notLeader reports, for a StateStore that knows about leadership (i.e. a
+// RaftStateStore), whether this replica should refuse to serve worker RPCs
+// right now. A plain JSONLogStore has no such concept, so single-node
+// deployments always answer.
+func (c *Coordinator) notLeader() bool {
+	lc, ok := c.store.(interface{ IsLeader() bool })
+	return ok && !lc.IsLeader()
+}
+
+// Register lets a worker announce the host its input splits are local to
+// and the address its file-fetch RPC server listens on. The returned id
+// must be sent back on every subsequent Heartbeat/Report. Like Heartbeat
+// and Report, this must go through c.store: findIdleTask and
+// fetchMapOutput both key off c.workers, so a Register that only mutated
+// this replica's in-memory map would leave whichever replica later serves
+// this worker's Heartbeat/Report with no Host/Address for it, and would
+// let two workers registering against different replicas collide on the
+// same WorkerId.
+func (c *Coordinator) Register(request *RegisterRequest, response *RegisterResponse) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.notLeader() {
+		return ErrNotLeader
+	}
+
+	id := c.nextWorkerId
+	if err := c.store.Append(StateEntry{
+		Type:     EntryRegistered,
+		WorkerId: id,
+		Host:     request.Host,
+		Address:  request.Address,
+	}); err != nil {
+		return err
+	}
+
+	c.nextWorkerId++
+	c.workers[id] = workerInfo{Host: request.Host, Address: request.Address}
+	response.WorkerId = id
+	return nil
+}
+
+// Heartbeat is called by workers to ask for work. It hands out the next
+// idle task for the current phase; once the phase is nearly done it also
+// hands out duplicate, backup copies of whichever tasks have been running
+// suspiciously long, so a single slow machine can't stall the whole job.
+func (c *Coordinator) Heartbeat(request *HeartbeatRequest, response *HeartbeatResponse) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.notLeader() {
+		return ErrNotLeader
+	}
+
+	if c.phase == CompletePhase {
+		response.JobType = CompleteJob
+		return nil
+	}
+
+	if t := c.findIdleTask(request.WorkerId); t != nil {
+		return c.assign(t, response)
+	}
+
+	if t := c.findStraggler(); t != nil {
+		// Backup attempt: same task id, new attempt id, startTime reset so
+		// we don't immediately redispatch yet another copy next heartbeat.
+		return c.assign(t, response)
+	}
+
+	response.JobType = WaitJob
+	return nil
+}
+
+// findIdleTask returns an idle task, preferring one whose input split is
+// local to the requesting worker's host (GFS-style locality) when we're
+// still in the Map phase and know where the split lives.
+func (c *Coordinator) findIdleTask(workerId int) *task {
+	host := c.workers[workerId].Host
+	var fallback *task
+	for i := range c.tasks {
+		t := &c.tasks[i]
+		if t.status != Idle {
+			continue
+		}
+		if fallback == nil {
+			fallback = t
+		}
+		if c.phase == MapPhase && host != "" && c.splitLocations[t.fileName] == host {
+			return t
+		}
+	}
+	return fallback
+}
+
+func (c *Coordinator) findStraggler() *task {
+	for i := range c.tasks {
+		t := &c.tasks[i]
+		if t.status == Working && time.Since(t.startTime) > CrashThreshold {
+			return t
+		}
+	}
+
+	if len(c.tasks) == 0 || float64(c.doneCount)/float64(len(c.tasks)) < backupPhaseDoneRatio {
+		return nil
+	}
+	for i := range c.tasks {
+		t := &c.tasks[i]
+		if t.status == Working && time.Since(t.startTime) > BackupThreshold {
+			return t
+		}
+	}
+	return nil
+}
+
+func (c *Coordinator) assign(t *task, response *HeartbeatResponse) error {
+	attemptId := t.nextAttempt
+
+	if err := c.store.Append(StateEntry{
+		Type:      EntryAssigned,
+		Phase:     c.phase,
+		TaskId:    t.id,
+		AttemptId: attemptId,
+	}); err != nil {
+		return err
+	}
+
+	t.status = Working
+	t.startTime = time.Now()
+	t.nextAttempt++
+
+	if c.phase == MapPhase {
+		response.JobType = MapJob
+		response.FilePath = t.fileName
+		response.Offset = t.offset
+		response.Length = t.length
+		response.SplitSize = DefaultSplitSize
+	} else {
+		response.JobType = ReduceJob
+		response.MapLocations = append([]string(nil), c.mapLocations...)
+	}
+	response.Id = t.id
+	response.AttemptId = attemptId
+	response.NReduce = c.nReduce
+	response.NMap = c.nMap
+	return nil
+}
+
+// Report is called by a worker once it finishes a task. Because of backup
+// execution, multiple attempts of the same task id may report; the first
+// one to arrive wins and later reports for that task id are ignored, so a
+// straggler's stale output never clobbers the winner's.
+func (c *Coordinator) Report(request *ReportRequest, response *ReportResponse) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.notLeader() {
+		return ErrNotLeader
+	}
+
+	if c.seen[request.IdempotencyKey] {
+		// Already applied (either earlier, or replayed from the log after
+		// a crash/leader change); treat as success without double-counting.
+		return nil
+	}
+
+	if request.Phase != c.phase {
+		// Report from a stale phase (e.g. a lingering backup Map attempt
+		// after we've already moved on to Reduce); nothing to do.
+		return nil
+	}
+
+	t := &c.tasks[request.Id]
+	if t.status == Finished {
+		return nil
+	}
+
+	if err := c.store.Append(StateEntry{
+		Type:           EntryCompleted,
+		Phase:          c.phase,
+		TaskId:         request.Id,
+		AttemptId:      request.AttemptId,
+		WorkerId:       request.WorkerId,
+		IdempotencyKey: request.IdempotencyKey,
+	}); err != nil {
+		return err
+	}
+	c.seen[request.IdempotencyKey] = true
+
+	t.status = Finished
+	c.doneCount++
+
+	if c.phase == MapPhase {
+		c.mapLocations[t.id] = c.workers[request.WorkerId].Address
+	}
+
+	if c.doneCount == len(c.tasks) {
+		if err := c.store.Append(StateEntry{Type: EntryPhaseAdvanced, Phase: c.phase}); err != nil {
+			return err
+		}
+		c.advancePhase()
+	}
+	return nil
+}
+
+func (c *Coordinator) advancePhase() {
+	switch c.phase {
+	case MapPhase:
+		c.phase = ReducePhase
+		c.tasks = make([]task, c.nReduce)
+		for i := range c.tasks {
+			c.tasks[i] = task{id: i, status: Idle}
+		}
+		c.doneCount = 0
+	case ReducePhase:
+		c.phase = CompletePhase
+	}
+}
+
+// an example RPC handler, kept around as a sanity check that net/rpc
+// registration is wired up; the worker doesn't call it.
+func (c *Coordinator) Example(args *ExampleArgs, reply *ExampleReply) error {
+	reply.Y = args.X + 1
+	return nil
+}
+
+type ExampleArgs struct {
+	X int
+}
+
+type ExampleReply struct {
+	Y int
+}
+
+// start a thread that listens for RPCs from worker.go
+func (c *Coordinator) server(sockname string) {
+	rpc.Register(c)
+	rpc.HandleHTTP()
+	os.Remove(sockname)
+	l, e := net.Listen("unix", sockname)
+	if e != nil {
+		log.Fatal("listen error:", e)
+	}
+	go http.Serve(l, nil)
+}
+
+// Done is called periodically by main/mrcoordinator.go to find out if the
+// entire job has finished.
+func (c *Coordinator) Done() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.phase == CompletePhase
+}
@@ -0,0 +1,99 @@
+package mr
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestCoordinator(t *testing.T, nTasks int) *Coordinator {
+	t.Helper()
+	store := NewJSONLogStore(filepath.Join(t.TempDir(), "state.log"))
+	c := &Coordinator{
+		nReduce: nTasks,
+		nMap:    nTasks,
+		phase:   MapPhase,
+		tasks:   make([]task, nTasks),
+		workers: make(map[int]workerInfo),
+		store:   store,
+		seen:    make(map[string]bool),
+	}
+	for i := range c.tasks {
+		c.tasks[i] = task{id: i, status: Idle}
+	}
+	return c
+}
+
+// A task stuck well past CrashThreshold must be reissued even when the
+// phase is nowhere near backupPhaseDoneRatio done, so a single worker
+// crash in a small job (common in this lab) can't hang forever.
+func TestFindStragglerReissuesCrashedTaskBelowDoneRatio(t *testing.T) {
+	c := newTestCoordinator(t, 8)
+	c.tasks[0].status = Working
+	c.tasks[0].startTime = time.Now().Add(-2 * CrashThreshold)
+
+	got := c.findStraggler()
+	if got == nil || got.id != 0 {
+		t.Fatalf("expected task 0 to be reissued as a crash straggler, got %v", got)
+	}
+}
+
+// Below both CrashThreshold and the near-completion ratio, a merely slow
+// (not crashed) task must not be treated as a straggler yet.
+func TestFindStragglerNilWhenNeitherThresholdCrossed(t *testing.T) {
+	c := newTestCoordinator(t, 8)
+	c.tasks[0].status = Working
+	c.tasks[0].startTime = time.Now().Add(-2 * BackupThreshold)
+
+	if got := c.findStraggler(); got != nil {
+		t.Fatalf("expected no straggler yet, got %v", got)
+	}
+}
+
+// findIdleTask must prefer a task whose input is local to the requesting
+// worker's host over an earlier-indexed idle task on a different host.
+func TestFindIdleTaskPrefersLocalHost(t *testing.T) {
+	c := newTestCoordinator(t, 3)
+	c.tasks[0].fileName = "a.txt"
+	c.tasks[1].fileName = "b.txt"
+	c.tasks[2].fileName = "c.txt"
+	c.splitLocations = map[string]string{"b.txt": "worker2"}
+	c.workers[7] = workerInfo{Host: "worker2"}
+
+	got := c.findIdleTask(7)
+	if got == nil || got.id != 1 {
+		t.Fatalf("expected task 1 (local to worker2), got %v", got)
+	}
+}
+
+// With no locality match, findIdleTask falls back to the first idle task.
+func TestFindIdleTaskFallsBackWithoutLocalityMatch(t *testing.T) {
+	c := newTestCoordinator(t, 3)
+	c.tasks[0].fileName = "a.txt"
+	c.tasks[1].fileName = "b.txt"
+	c.splitLocations = map[string]string{"b.txt": "worker2"}
+	c.workers[7] = workerInfo{Host: "worker3"}
+
+	got := c.findIdleTask(7)
+	if got == nil || got.id != 0 {
+		t.Fatalf("expected fallback to task 0, got %v", got)
+	}
+}
+
+// Once the phase is mostly done, a task running longer than BackupThreshold
+// (but not CrashThreshold) is still backed up, preserving the original
+// near-completion straggler behavior.
+func TestFindStragglerBackupNearPhaseCompletion(t *testing.T) {
+	c := newTestCoordinator(t, 10)
+	c.doneCount = 9
+	for i := 1; i < 10; i++ {
+		c.tasks[i].status = Finished
+	}
+	c.tasks[0].status = Working
+	c.tasks[0].startTime = time.Now().Add(-2 * BackupThreshold)
+
+	got := c.findStraggler()
+	if got == nil || got.id != 0 {
+		t.Fatalf("expected task 0 to be backed up near completion, got %v", got)
+	}
+}
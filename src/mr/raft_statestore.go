@@ -0,0 +1,602 @@
+package mr
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"math/rand"
+	"net"
+	"net/rpc"
+	"os"
+	"sync"
+	"time"
+)
+
+//
+// RaftStateStore replicates a StateEntry log across a small group of
+// coordinator replicas, so the job survives losing whichever machine the
+// current leader runs on. It implements just enough Raft to be useful
+// here: randomized-timeout leader election, index/term-matched log
+// replication (a follower that's behind or has a diverged suffix gets
+// caught up, not just blindly appended to), and on-disk persistence of
+// term/votedFor/log so a crashed replica can't double-vote or forget
+// committed entries on restart. There is deliberately no snapshotting/log
+// compaction - fine for a log of "task X assigned/completed" entries from
+// a single MR job, not something you'd run for months.
+//
+
+const (
+	electionTimeoutMin = 300 * time.Millisecond
+	electionTimeoutMax = 600 * time.Millisecond
+	heartbeatInterval  = 100 * time.Millisecond
+	tickInterval       = 20 * time.Millisecond
+)
+
+// ErrNotLeader is returned by Append when this replica isn't the current
+// leader; the caller should find the leader (or just retry) elsewhere.
+var ErrNotLeader = errors.New("mr: not the raft leader")
+
+type raftRole int
+
+const (
+	raftFollower raftRole = iota
+	raftCandidate
+	raftLeader
+)
+
+// RaftPeer is one member of the replica group.
+type RaftPeer struct {
+	Id      int
+	Address string // host:port the peer's Raft RPC server listens on
+}
+
+type RaftStateStore struct {
+	mu sync.Mutex
+
+	selfId int
+	peers  []RaftPeer // includes self
+
+	term     int
+	votedFor int
+	role     raftRole
+
+	log []StateEntry
+
+	// nextIndex[peerId] is the 1-based log index this leader believes peer
+	// needs next. Lazily initialized to len(log)+1 and corrected by
+	// appendEntriesOnce as AppendEntries responses come back.
+	nextIndex map[int]int
+
+	lastHeartbeat   time.Time
+	electionTimeout time.Duration
+
+	clients map[int]*rpc.Client
+
+	// persistPath, if set, is where term/votedFor/log are durably written
+	// before this replica replies to a RequestVote or AppendEntries RPC,
+	// so a crash and restart can't cause a double vote or a forgotten log
+	// entry. Empty disables persistence (e.g. in tests).
+	persistPath string
+}
+
+// persistedState is the on-disk record written by persistLocked and read
+// back by loadPersisted.
+type persistedState struct {
+	Term     int
+	VotedFor int
+	Log      []StateEntry
+}
+
+// NewRaftStateStore starts a replica's Raft RPC server and its
+// election/heartbeat loop. peers must list every replica, including self.
+// persistPath is where this replica's term/votedFor/log survive a
+// restart; pass "" to keep them in memory only (e.g. in tests).
+func NewRaftStateStore(selfId int, peers []RaftPeer, persistPath string) *RaftStateStore {
+	r := &RaftStateStore{
+		selfId:          selfId,
+		peers:           peers,
+		votedFor:        -1,
+		role:            raftFollower,
+		lastHeartbeat:   time.Now(),
+		electionTimeout: randomElectionTimeout(),
+		clients:         make(map[int]*rpc.Client),
+		nextIndex:       make(map[int]int),
+		persistPath:     persistPath,
+	}
+	if err := r.loadPersisted(); err != nil {
+		log.Fatalf("raft: cannot load persisted state: %v", err)
+	}
+	r.serve()
+	go r.run()
+	return r
+}
+
+func randomElectionTimeout() time.Duration {
+	span := electionTimeoutMax - electionTimeoutMin
+	return electionTimeoutMin + time.Duration(rand.Int63n(int64(span)))
+}
+
+// loadPersisted restores term/votedFor/log from persistPath, if present.
+// A missing file means a fresh replica with no prior state, not an error.
+func (r *RaftStateStore) loadPersisted() error {
+	if r.persistPath == "" {
+		return nil
+	}
+	data, err := os.ReadFile(r.persistPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var ps persistedState
+	if err := json.Unmarshal(data, &ps); err != nil {
+		return err
+	}
+	r.term = ps.Term
+	r.votedFor = ps.VotedFor
+	r.log = ps.Log
+	return nil
+}
+
+// persistLocked fsyncs term/votedFor/log to persistPath. Callers must hold
+// r.mu and must call this before a RequestVote/AppendEntries RPC handler
+// replies, since the reply is a promise about what this replica won't do
+// again after a restart (vote twice in the same term, forget a log entry).
+func (r *RaftStateStore) persistLocked() error {
+	if r.persistPath == "" {
+		return nil
+	}
+	data, err := json.Marshal(persistedState{Term: r.term, VotedFor: r.votedFor, Log: r.log})
+	if err != nil {
+		return err
+	}
+	tmp := r.persistPath + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.persistPath)
+}
+
+func (r *RaftStateStore) selfAddress() string {
+	for _, p := range r.peers {
+		if p.Id == r.selfId {
+			return p.Address
+		}
+	}
+	return ""
+}
+
+func (r *RaftStateStore) serve() {
+	addr := r.selfAddress()
+	if addr == "" {
+		log.Fatalf("raft: self id %d not present in peer list", r.selfId)
+	}
+	server := rpc.NewServer()
+	if err := server.RegisterName("Raft", r); err != nil {
+		log.Fatalf("raft: register error: %v", err)
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatalf("raft: listen error: %v", err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go server.ServeConn(conn)
+		}
+	}()
+}
+
+// client returns a cached connection to peer, dialing one if we don't have
+// it (yet, or anymore - a failed call evicts its entry so the next attempt
+// redials instead of being stuck on a connection to a peer that restarted).
+func (r *RaftStateStore) client(peer RaftPeer) (*rpc.Client, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if c, ok := r.clients[peer.Id]; ok {
+		return c, nil
+	}
+	c, err := rpc.Dial("tcp", peer.Address)
+	if err != nil {
+		return nil, err
+	}
+	r.clients[peer.Id] = c
+	return c, nil
+}
+
+func (r *RaftStateStore) evictClient(peerId int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if c, ok := r.clients[peerId]; ok {
+		c.Close()
+		delete(r.clients, peerId)
+	}
+}
+
+func (r *RaftStateStore) run() {
+	for {
+		time.Sleep(tickInterval)
+
+		r.mu.Lock()
+		role := r.role
+		sinceHeartbeat := time.Since(r.lastHeartbeat)
+		timeout := r.electionTimeout
+		r.mu.Unlock()
+
+		if role == raftLeader {
+			r.sendHeartbeats()
+			continue
+		}
+		if sinceHeartbeat > timeout {
+			r.startElection()
+		}
+	}
+}
+
+func (r *RaftStateStore) startElection() {
+	r.mu.Lock()
+	r.role = raftCandidate
+	r.term++
+	r.votedFor = r.selfId
+	term := r.term
+	r.lastHeartbeat = time.Now()
+	r.electionTimeout = randomElectionTimeout()
+	lastLogIndex := len(r.log)
+	lastLogTerm := 0
+	if lastLogIndex > 0 {
+		lastLogTerm = r.log[lastLogIndex-1].Term
+	}
+	peers := append([]RaftPeer(nil), r.peers...)
+	persistErr := r.persistLocked()
+	r.mu.Unlock()
+	if persistErr != nil {
+		log.Fatalf("raft: cannot persist state: %v", persistErr)
+	}
+
+	votes := 1 // vote for self
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, peer := range peers {
+		if peer.Id == r.selfId {
+			continue
+		}
+		wg.Add(1)
+		go func(peer RaftPeer) {
+			defer wg.Done()
+			response := RequestVoteResponse{}
+			if err := r.call(peer, "Raft.RequestVote", &RequestVoteRequest{
+				Term:         term,
+				CandidateId:  r.selfId,
+				LastLogIndex: lastLogIndex,
+				LastLogTerm:  lastLogTerm,
+			}, &response); err != nil {
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if response.VoteGranted {
+				votes++
+			} else if response.Term > term {
+				r.stepDown(response.Term)
+			}
+		}(peer)
+	}
+	wg.Wait()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.role == raftCandidate && r.term == term && votes*2 > len(peers) {
+		r.role = raftLeader
+		for _, peer := range r.peers {
+			r.nextIndex[peer.Id] = len(r.log) + 1
+		}
+	}
+}
+
+// stepDown drops back to follower for a newer term seen in an RPC
+// response. It's not on the critical path persistLocked guards (the
+// replica hasn't promised anything by stepping down), so a failure here
+// only costs an extra election later, not correctness - log and move on
+// instead of crashing the process over it.
+func (r *RaftStateStore) stepDown(term int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if term > r.term {
+		r.term = term
+		r.role = raftFollower
+		r.votedFor = -1
+		if err := r.persistLocked(); err != nil {
+			log.Printf("raft: cannot persist state after stepping down: %v", err)
+		}
+	}
+}
+
+func (r *RaftStateStore) sendHeartbeats() {
+	r.mu.Lock()
+	term := r.term
+	peers := append([]RaftPeer(nil), r.peers...)
+	r.mu.Unlock()
+
+	for _, peer := range peers {
+		if peer.Id == r.selfId {
+			continue
+		}
+		go func(peer RaftPeer) {
+			r.appendEntriesOnce(peer, term)
+		}(peer)
+	}
+}
+
+func (r *RaftStateStore) call(peer RaftPeer, rpcName string, args, reply interface{}) error {
+	c, err := r.client(peer)
+	if err != nil {
+		return err
+	}
+	if err := c.Call(rpcName, args, reply); err != nil {
+		r.evictClient(peer.Id)
+		return err
+	}
+	return nil
+}
+
+// appendEntriesOnce sends one AppendEntries RPC to peer carrying every
+// entry from peer's believed nextIndex through the end of our log (so it
+// also serves as a heartbeat when that's empty). accepted reports whether
+// the follower's log now matches ours up through those entries; retriable
+// reports whether a rejection was a log mismatch worth backing nextIndex
+// off and trying again, as opposed to an unreachable peer or us no longer
+// being leader for this term.
+func (r *RaftStateStore) appendEntriesOnce(peer RaftPeer, term int) (accepted bool, retriable bool) {
+	r.mu.Lock()
+	if r.role != raftLeader || r.term != term {
+		r.mu.Unlock()
+		return false, false
+	}
+	next, ok := r.nextIndex[peer.Id]
+	if !ok || next < 1 {
+		next = len(r.log) + 1
+	}
+	prevLogIndex := next - 1
+	prevLogTerm := 0
+	if prevLogIndex > 0 && prevLogIndex <= len(r.log) {
+		prevLogTerm = r.log[prevLogIndex-1].Term
+	}
+	var entries []StateEntry
+	if next-1 < len(r.log) {
+		entries = append([]StateEntry(nil), r.log[next-1:]...)
+	}
+	r.mu.Unlock()
+
+	response := AppendEntriesResponse{}
+	if err := r.call(peer, "Raft.AppendEntries", &AppendEntriesRequest{
+		Term:         term,
+		LeaderId:     r.selfId,
+		PrevLogIndex: prevLogIndex,
+		PrevLogTerm:  prevLogTerm,
+		Entries:      entries,
+	}, &response); err != nil {
+		return false, false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if response.Term > term {
+		if response.Term > r.term {
+			r.term = response.Term
+			r.role = raftFollower
+			r.votedFor = -1
+			if err := r.persistLocked(); err != nil {
+				log.Printf("raft: cannot persist state after stepping down: %v", err)
+			}
+		}
+		return false, false
+	}
+	if response.Success {
+		r.nextIndex[peer.Id] = next + len(entries)
+		return true, false
+	}
+	if r.nextIndex[peer.Id] > 1 {
+		r.nextIndex[peer.Id] = next - 1
+	}
+	return false, true
+}
+
+// Append replicates entry to a majority of the group before returning. It
+// only succeeds on the current leader; everywhere else it returns
+// ErrNotLeader so the caller knows to find the real leader.
+func (r *RaftStateStore) Append(entry StateEntry) error {
+	r.mu.Lock()
+	if r.role != raftLeader {
+		r.mu.Unlock()
+		return ErrNotLeader
+	}
+	term := r.term
+	entry.Term = term
+	r.log = append(r.log, entry)
+	if err := r.persistLocked(); err != nil {
+		r.log = r.log[:len(r.log)-1]
+		r.mu.Unlock()
+		return err
+	}
+	peers := append([]RaftPeer(nil), r.peers...)
+	r.mu.Unlock()
+
+	acked := 1 // self
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, peer := range peers {
+		if peer.Id == r.selfId {
+			continue
+		}
+		wg.Add(1)
+		go func(peer RaftPeer) {
+			defer wg.Done()
+			// Retry with a backed-off nextIndex until the follower's log
+			// matches ours (catches it up from however far behind, or
+			// overwrites a diverged suffix left by a previous leader) or
+			// it's unreachable/we're no longer leader for this term.
+			for {
+				accepted, retriable := r.appendEntriesOnce(peer, term)
+				if accepted {
+					mu.Lock()
+					acked++
+					mu.Unlock()
+					return
+				}
+				if !retriable {
+					return
+				}
+			}
+		}(peer)
+	}
+	wg.Wait()
+
+	if acked*2 <= len(peers) {
+		return errors.New("mr: failed to replicate entry to a majority of the raft group")
+	}
+	return nil
+}
+
+// Replay calls apply once per entry in this replica's log, in order. Call
+// it after a leader change (or on startup) to rebuild task tables before
+// serving new requests.
+func (r *RaftStateStore) Replay(apply func(StateEntry)) error {
+	r.mu.Lock()
+	entries := append([]StateEntry(nil), r.log...)
+	r.mu.Unlock()
+
+	for _, entry := range entries {
+		apply(entry)
+	}
+	return nil
+}
+
+// IsLeader reports whether this replica currently believes it's the
+// leader. The Coordinator only answers worker Heartbeat/Report RPCs when
+// this is true.
+func (r *RaftStateStore) IsLeader() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.role == raftLeader
+}
+
+type RequestVoteRequest struct {
+	Term         int
+	CandidateId  int
+	LastLogIndex int
+	LastLogTerm  int
+}
+
+type RequestVoteResponse struct {
+	Term        int
+	VoteGranted bool
+}
+
+// RequestVote is called by a candidate asking for this replica's vote.
+func (r *RaftStateStore) RequestVote(request *RequestVoteRequest, response *RequestVoteResponse) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if request.Term > r.term {
+		r.term = request.Term
+		r.role = raftFollower
+		r.votedFor = -1
+	}
+	response.Term = r.term
+
+	lastLogTerm := 0
+	if len(r.log) > 0 {
+		lastLogTerm = r.log[len(r.log)-1].Term
+	}
+	// A candidate is at least as up to date as us if its last log entry
+	// has a strictly higher term, or the same term with an index at least
+	// as large as ours - comparing log length alone (as before) let a
+	// candidate with a shorter but higher-term log lose to one with a
+	// longer but stale one, which can discard committed entries.
+	upToDate := request.LastLogTerm > lastLogTerm ||
+		(request.LastLogTerm == lastLogTerm && request.LastLogIndex >= len(r.log))
+
+	if request.Term == r.term && (r.votedFor == -1 || r.votedFor == request.CandidateId) && upToDate {
+		r.votedFor = request.CandidateId
+		r.lastHeartbeat = time.Now()
+		response.VoteGranted = true
+	}
+
+	if err := r.persistLocked(); err != nil {
+		return err
+	}
+	return nil
+}
+
+type AppendEntriesRequest struct {
+	Term         int
+	LeaderId     int
+	PrevLogIndex int // 0 means "no preceding entry required"
+	PrevLogTerm  int
+	Entries      []StateEntry
+}
+
+type AppendEntriesResponse struct {
+	Term    int
+	Success bool
+}
+
+// AppendEntries is called by the leader, both as a heartbeat (no entries)
+// and to replicate newly Appended entries. A follower only accepts
+// Entries if its log already agrees with the leader's at PrevLogIndex/
+// PrevLogTerm; otherwise it rejects so the leader backs off nextIndex and
+// retries, which is how a follower that missed entries (or has a
+// diverged suffix from a previous leader) gets caught up instead of
+// silently drifting.
+func (r *RaftStateStore) AppendEntries(request *AppendEntriesRequest, response *AppendEntriesResponse) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if request.Term < r.term {
+		response.Term = r.term
+		response.Success = false
+		return nil
+	}
+
+	r.term = request.Term
+	r.role = raftFollower
+	r.votedFor = request.LeaderId
+	r.lastHeartbeat = time.Now()
+
+	if request.PrevLogIndex > 0 {
+		if request.PrevLogIndex > len(r.log) || r.log[request.PrevLogIndex-1].Term != request.PrevLogTerm {
+			response.Term = r.term
+			response.Success = false
+			if err := r.persistLocked(); err != nil {
+				return err
+			}
+			return nil
+		}
+	}
+
+	r.log = append(r.log[:request.PrevLogIndex], request.Entries...)
+
+	if err := r.persistLocked(); err != nil {
+		return err
+	}
+
+	response.Term = r.term
+	response.Success = true
+	return nil
+}
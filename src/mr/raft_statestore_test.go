@@ -0,0 +1,132 @@
+package mr
+
+import (
+	"net/rpc"
+	"path/filepath"
+	"testing"
+)
+
+func newTestRaftStateStore(persistPath string) *RaftStateStore {
+	return &RaftStateStore{
+		selfId:      0,
+		peers:       []RaftPeer{{Id: 0, Address: ""}, {Id: 1, Address: ""}},
+		votedFor:    -1,
+		nextIndex:   make(map[int]int),
+		clients:     make(map[int]*rpc.Client),
+		persistPath: persistPath,
+	}
+}
+
+// AppendEntries must reject a request whose PrevLogIndex/PrevLogTerm don't
+// match this replica's log, instead of blindly appending and diverging
+// from what a prior majority actually committed.
+func TestRaftAppendEntriesRejectsLogMismatch(t *testing.T) {
+	r := newTestRaftStateStore("")
+	r.term = 1
+	r.log = []StateEntry{{Type: EntryAssigned, Term: 1, TaskId: 0}}
+
+	req := &AppendEntriesRequest{
+		Term:         2,
+		LeaderId:     1,
+		PrevLogIndex: 1,
+		PrevLogTerm:  99, // wrong term for index 1
+		Entries:      []StateEntry{{Type: EntryCompleted, Term: 2, TaskId: 1}},
+	}
+	resp := &AppendEntriesResponse{}
+	if err := r.AppendEntries(req, resp); err != nil {
+		t.Fatalf("AppendEntries: %v", err)
+	}
+	if resp.Success {
+		t.Fatalf("expected rejection on log mismatch")
+	}
+	if len(r.log) != 1 {
+		t.Fatalf("log must be unchanged on rejection, got %v", r.log)
+	}
+}
+
+// A matching PrevLogIndex/PrevLogTerm must be accepted and the new
+// entries appended (and a diverged suffix past PrevLogIndex discarded).
+func TestRaftAppendEntriesAcceptsOnMatchAndTruncatesDivergedSuffix(t *testing.T) {
+	r := newTestRaftStateStore("")
+	r.term = 1
+	r.log = []StateEntry{
+		{Type: EntryAssigned, Term: 1, TaskId: 0},
+		{Type: EntryAssigned, Term: 1, TaskId: 99}, // stale entry a new leader will overwrite
+	}
+
+	req := &AppendEntriesRequest{
+		Term:         2,
+		LeaderId:     1,
+		PrevLogIndex: 1,
+		PrevLogTerm:  1,
+		Entries:      []StateEntry{{Type: EntryCompleted, Term: 2, TaskId: 1}},
+	}
+	resp := &AppendEntriesResponse{}
+	if err := r.AppendEntries(req, resp); err != nil {
+		t.Fatalf("AppendEntries: %v", err)
+	}
+	if !resp.Success {
+		t.Fatalf("expected acceptance on matching prev log")
+	}
+	if len(r.log) != 2 || r.log[1].TaskId != 1 {
+		t.Fatalf("expected the diverged entry replaced by the leader's, got %v", r.log)
+	}
+}
+
+// RequestVote's up-to-date check must compare (lastLogTerm, lastLogIndex),
+// not just log length: a candidate with a shorter log from a newer term is
+// more up to date than a voter with a longer log from an older term.
+func TestRaftRequestVoteComparesTermBeforeLength(t *testing.T) {
+	r := newTestRaftStateStore("")
+	r.term = 5
+	r.log = []StateEntry{
+		{Term: 1}, {Term: 1}, {Term: 1}, // long log, but all from term 1
+	}
+
+	req := &RequestVoteRequest{Term: 5, CandidateId: 1, LastLogIndex: 1, LastLogTerm: 2}
+	resp := &RequestVoteResponse{}
+	if err := r.RequestVote(req, resp); err != nil {
+		t.Fatalf("RequestVote: %v", err)
+	}
+	if !resp.VoteGranted {
+		t.Fatalf("expected vote granted to a candidate with a newer-term log")
+	}
+}
+
+func TestRaftRequestVoteDeniesStaleCandidate(t *testing.T) {
+	r := newTestRaftStateStore("")
+	r.term = 5
+	r.log = []StateEntry{{Term: 3}, {Term: 3}}
+
+	req := &RequestVoteRequest{Term: 5, CandidateId: 1, LastLogIndex: 1, LastLogTerm: 1}
+	resp := &RequestVoteResponse{}
+	if err := r.RequestVote(req, resp); err != nil {
+		t.Fatalf("RequestVote: %v", err)
+	}
+	if resp.VoteGranted {
+		t.Fatalf("expected vote denied to a candidate with a staler log")
+	}
+}
+
+// term/votedFor/log must survive a restart, so a crashed replica can't
+// double-vote in a term it already voted in, or forget committed entries.
+func TestRaftPersistenceRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "raft.state")
+
+	r := newTestRaftStateStore(path)
+	r.term = 7
+	r.votedFor = 3
+	r.log = []StateEntry{{Type: EntryAssigned, Term: 7, TaskId: 0}}
+	if err := r.persistLocked(); err != nil {
+		t.Fatalf("persistLocked: %v", err)
+	}
+
+	restored := newTestRaftStateStore(path)
+	if err := restored.loadPersisted(); err != nil {
+		t.Fatalf("loadPersisted: %v", err)
+	}
+	if restored.term != 7 || restored.votedFor != 3 || len(restored.log) != 1 || restored.log[0].TaskId != 0 {
+		t.Fatalf("restored state doesn't match: term=%d votedFor=%d log=%v",
+			restored.term, restored.votedFor, restored.log)
+	}
+}
@@ -0,0 +1,114 @@
+package mr
+
+//
+// RPC definitions shared between coordinator and worker.
+//
+// remember to capitalize all names.
+//
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type JobType int
+
+const (
+	MapJob JobType = iota
+	ReduceJob
+	WaitJob
+	CompleteJob
+)
+
+type SchedulePhase int
+
+const (
+	MapPhase SchedulePhase = iota
+	ReducePhase
+	CompletePhase
+)
+
+type HeartbeatRequest struct {
+	WorkerId int
+}
+
+type HeartbeatResponse struct {
+	JobType   JobType
+	FilePath  string
+	Id        int // task id
+	AttemptId int // which attempt of Id this is, for backup-task dedup
+	NReduce   int
+	NMap      int
+	// MapLocations holds, for a ReduceJob, the fetch address of the worker
+	// that produced each mr-X-Y shard (indexed by map task id), so the
+	// reducer can pull it over RPC instead of assuming a shared filesystem.
+	MapLocations []string
+
+	// For a MapJob, the [Offset, Offset+Length) byte range of FilePath this
+	// task owns, aligned to record boundaries by the RecordReader. A zero
+	// SplitSize means FilePath should be read in full, for compatibility
+	// with responses from before splits existed.
+	SplitSize int64
+	Offset    int64
+	Length    int64
+}
+
+type ReportRequest struct {
+	Id        int
+	AttemptId int
+	Phase     SchedulePhase
+	WorkerId  int
+	// IdempotencyKey lets the coordinator tell a genuinely new Report from
+	// one it (or a previous leader) already applied, e.g. after a retry
+	// following a leader change.
+	IdempotencyKey string
+}
+
+type ReportResponse struct {
+}
+
+type RegisterRequest struct {
+	Host    string // hostname the worker's input splits would be local to
+	Address string // address of the worker's file-fetch RPC server
+}
+
+type RegisterResponse struct {
+	WorkerId int
+}
+
+// Cook up a unique-ish UNIX-domain socket name in /var/tmp, for the
+// coordinator. Can't use the current directory since Athena AFS doesn't
+// support UNIX-domain sockets.
+func coordinatorSock() string {
+	s := "/var/tmp/824-mr-"
+	s += strconv.Itoa(os.Getuid())
+	return s
+}
+
+// CoordinatorSockPrefix exposes coordinatorSock() to main/mrcoordinator.go,
+// which appends a per-replica suffix when running as a raft group.
+func CoordinatorSockPrefix() string {
+	return coordinatorSock()
+}
+
+// coordinatorSocks returns every coordinator replica's socket a worker
+// should be willing to talk to. With a raft-backed StateStore there are
+// several (one per replica, since only the current leader answers RPCs);
+// MR_COORDINATOR_SOCKS carries them as a comma-separated list. A single-
+// node deployment (the default) just has the one socket.
+func coordinatorSocks() []string {
+	if env := os.Getenv("MR_COORDINATOR_SOCKS"); env != "" {
+		return strings.Split(env, ",")
+	}
+	return []string{coordinatorSock()}
+}
+
+func generateMapResultFileName(mapId, reduceId int) string {
+	return fmt.Sprintf("mr-%d-%d", mapId, reduceId)
+}
+
+func generateReduceResultFileName(reduceId int) string {
+	return fmt.Sprintf("mr-out-%d", reduceId)
+}
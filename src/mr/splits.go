@@ -0,0 +1,137 @@
+package mr
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+)
+
+// DefaultSplitSize bounds how many bytes of a single input file the
+// coordinator carves into one Map task, mirroring the paper's 16-64MB
+// split model instead of one task per whole file. It's a package-level
+// var (like BackupThreshold) so main/mrcoordinator.go can tune it with a
+// flag.
+var DefaultSplitSize int64 = 16 * 1024 * 1024
+
+// DefaultRecordReader finds record boundaries within a split. Swap it for
+// formats where a record isn't a newline-terminated line.
+var DefaultRecordReader RecordReader = NewlineRecordReader{}
+
+// RecordReader streams whole records out of the byte range [offset,
+// offset+length) of file. Implementations must extend past length to
+// finish whatever record straddles the boundary (so no record is ever
+// truncated) and must skip the partial record at the very start of the
+// range when offset > 0, since the preceding split's reader owns it by
+// reading past its own end for the same reason. When a single record is
+// larger than a split (so more than one split's [offset, offset+length)
+// falls entirely inside it), every split fully contained in that record
+// must emit nothing at all - the split that contains the record's start
+// already reads past its own end to emit the whole thing, and the next
+// record belongs to whichever split's range actually reaches past the
+// first one's end.
+type RecordReader interface {
+	ReadRecords(file *os.File, offset, length int64, emit func(string)) error
+}
+
+// NewlineRecordReader treats '\n' as the record separator, which is what
+// doMapTask/doReduceTask used before splits existed.
+type NewlineRecordReader struct{}
+
+func (NewlineRecordReader) ReadRecords(file *os.File, offset, length int64, emit func(string)) error {
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	end := offset + length
+	if end > info.Size() {
+		end = info.Size()
+	}
+
+	start := offset
+	if start > 0 {
+		skipped, err := skipPartialRecord(file, start)
+		if err != nil {
+			return err
+		}
+		start = skipped
+	}
+
+	if start >= end {
+		// The leading partial record didn't end until at or past our own
+		// end: this split's whole range is just the middle (or tail) of
+		// a record too large to fit in one split, and some other split
+		// owns both that record and whatever follows it.
+		return nil
+	}
+
+	if _, err := file.Seek(start, io.SeekStart); err != nil {
+		return err
+	}
+	reader := bufio.NewReader(file)
+	pos := start
+	for {
+		line, err := reader.ReadString('\n')
+		if len(line) > 0 {
+			pos += int64(len(line))
+			emit(strings.TrimRight(line, "\n"))
+		}
+		if err != nil {
+			return nil // EOF (or a short final record with no trailing \n)
+		}
+		if pos >= end {
+			return nil
+		}
+	}
+}
+
+// buildMapTasks enumerates Map tasks across files: each input file is
+// carved on its own into ceil(size/splitSize) fixed-size byte ranges, the
+// last one short if the file doesn't divide evenly, and a zero-byte file
+// gets a single empty task. No split spans two files. Record-boundary alignment
+// happens later, when a worker actually reads its split, so this doesn't
+// need to scan file contents.
+func buildMapTasks(files []string, splitSize int64) ([]task, error) {
+	var tasks []task
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		size := info.Size()
+		if size == 0 {
+			tasks = append(tasks, task{fileName: file, id: len(tasks), status: Idle})
+			continue
+		}
+		for offset := int64(0); offset < size; offset += splitSize {
+			length := splitSize
+			if offset+length > size {
+				length = size - offset
+			}
+			tasks = append(tasks, task{fileName: file, offset: offset, length: length, id: len(tasks), status: Idle})
+		}
+	}
+	return tasks, nil
+}
+
+// skipPartialRecord returns the offset of the first full record at or
+// after from, given that from may land in the middle of a record that
+// belongs to the previous split.
+func skipPartialRecord(file *os.File, from int64) (int64, error) {
+	if _, err := file.Seek(from-1, io.SeekStart); err != nil {
+		return 0, err
+	}
+	reader := bufio.NewReader(file)
+	b, err := reader.ReadByte()
+	if err != nil {
+		return from, nil // from is at/past EOF; nothing to skip
+	}
+	if b == '\n' {
+		return from, nil // from already starts a new record
+	}
+	rest, err := reader.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+	return from + int64(len(rest)), nil
+}
@@ -0,0 +1,149 @@
+package mr
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, contents string) *os.File {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "input.txt")
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+// Splitting a file into adjacent byte ranges must yield every record
+// exactly once, in order, with no record truncated at a split boundary.
+func TestNewlineRecordReaderCoversEveryRecordAcrossSplits(t *testing.T) {
+	contents := "alpha\nbravo\ncharlie\ndelta\necho\n"
+	f := writeTestFile(t, contents)
+
+	var got []string
+	emit := func(s string) { got = append(got, s) }
+
+	var reader NewlineRecordReader
+	// Split at byte 15, which lands mid-"charlie" ("alpha\nbravo\ncha" is
+	// 15 bytes, 3 bytes into "charlie"), so the first split must read past
+	// its nominal end to finish "charlie" and the second must skip that
+	// same already-consumed partial record rather than re-emit it.
+	if err := reader.ReadRecords(f, 0, 15, emit); err != nil {
+		t.Fatalf("ReadRecords(first split): %v", err)
+	}
+	if err := reader.ReadRecords(f, 15, int64(len(contents))-15, emit); err != nil {
+		t.Fatalf("ReadRecords(second split): %v", err)
+	}
+
+	want := []string{"alpha", "bravo", "charlie", "delta", "echo"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+// A split with no trailing newline on the final record must still emit it.
+func TestNewlineRecordReaderEmitsFinalRecordWithoutTrailingNewline(t *testing.T) {
+	f := writeTestFile(t, "only\nrecord")
+
+	var got []string
+	var reader NewlineRecordReader
+	if err := reader.ReadRecords(f, 0, 11, func(s string) { got = append(got, s) }); err != nil {
+		t.Fatalf("ReadRecords: %v", err)
+	}
+
+	want := []string{"only", "record"}
+	if len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+// A record larger than a single split must be read exactly once overall,
+// even when it fully occupies several splits in a row: only the split
+// containing its start should emit it (by reading past its own end), and
+// every split entirely swallowed by it must emit nothing, so the record
+// immediately following isn't picked up twice.
+func TestNewlineRecordReaderSkipsSplitsFullyInsideAnOversizedRecord(t *testing.T) {
+	giant := strings.Repeat("G", 50)
+	contents := "r1\n" + giant + "\n" + "r3\n"
+	f := writeTestFile(t, contents)
+
+	const splitSize = 10
+	var got []string
+	emit := func(s string) { got = append(got, s) }
+
+	var reader NewlineRecordReader
+	for offset := int64(0); offset < int64(len(contents)); offset += splitSize {
+		length := int64(splitSize)
+		if offset+length > int64(len(contents)) {
+			length = int64(len(contents)) - offset
+		}
+		if err := reader.ReadRecords(f, offset, length, emit); err != nil {
+			t.Fatalf("ReadRecords(offset=%d): %v", offset, err)
+		}
+	}
+
+	want := []string{"r1", giant, "r3"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v records, want exactly %v (no duplicates, no drops)", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestBuildMapTasksSplitsLargeFileIntoFixedSizeRanges(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "big.txt")
+	if err := os.WriteFile(path, make([]byte, 25), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	tasks, err := buildMapTasks([]string{path}, 10)
+	if err != nil {
+		t.Fatalf("buildMapTasks: %v", err)
+	}
+	if len(tasks) != 3 {
+		t.Fatalf("expected 3 splits of a 25-byte file at split size 10, got %d: %v", len(tasks), tasks)
+	}
+	wantOffsets := []int64{0, 10, 20}
+	wantLengths := []int64{10, 10, 5}
+	for i, task := range tasks {
+		if task.offset != wantOffsets[i] || task.length != wantLengths[i] {
+			t.Fatalf("task %d: got offset=%d length=%d, want offset=%d length=%d",
+				i, task.offset, task.length, wantOffsets[i], wantLengths[i])
+		}
+		if task.id != i {
+			t.Fatalf("task %d: got id=%d", i, task.id)
+		}
+	}
+}
+
+func TestBuildMapTasksZeroByteFileGetsOneTask(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "empty.txt")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	tasks, err := buildMapTasks([]string{path}, 10)
+	if err != nil {
+		t.Fatalf("buildMapTasks: %v", err)
+	}
+	if len(tasks) != 1 || tasks[0].length != 0 {
+		t.Fatalf("expected a single zero-length task, got %v", tasks)
+	}
+}
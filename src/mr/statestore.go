@@ -0,0 +1,110 @@
+package mr
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// EntryType is the kind of task-state transition a StateEntry records.
+type EntryType int
+
+const (
+	EntryAssigned EntryType = iota
+	EntryCompleted
+	EntryPhaseAdvanced
+	EntryRegistered
+)
+
+// StateEntry is one durable record of a coordinator decision: a task got
+// assigned to a worker, a task completed, the job moved to its next phase,
+// or a worker registered. Replaying a StateEntry log in order reconstructs
+// the in-memory task tables exactly.
+type StateEntry struct {
+	Type           EntryType
+	Phase          SchedulePhase
+	TaskId         int
+	AttemptId      int
+	WorkerId       int
+	IdempotencyKey string
+	// Host and Address are set by EntryRegistered: the host a worker's
+	// input splits are local to, and the address its file-fetch RPC server
+	// listens on. See workerInfo in coordinator.go.
+	Host    string
+	Address string
+	// Term is the raft term this entry was appended under. RaftStateStore
+	// sets and consults it for log matching (see AppendEntries); a
+	// JSONLogStore has no notion of terms and leaves it zero.
+	Term int
+}
+
+// StateStore durably records task-state transitions so a coordinator can
+// recover its task tables after a crash or a leader change instead of
+// re-running the whole job from scratch.
+type StateStore interface {
+	// Append durably records entry. The caller must not treat the
+	// transition as committed until Append returns nil.
+	Append(entry StateEntry) error
+	// Replay calls apply once per previously Appended entry, in the order
+	// Append was called, so the caller can rebuild its in-memory state.
+	Replay(apply func(StateEntry)) error
+}
+
+// JSONLogStore is a StateStore backed by a single fsync-per-write JSON
+// line log. It gives a single coordinator process crash durability: on
+// restart, Replay reads the log back and rebuilds the task tables. It does
+// not protect against losing the machine the log lives on; RaftStateStore
+// is for that.
+type JSONLogStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewJSONLogStore(path string) *JSONLogStore {
+	return &JSONLogStore{path: path}
+}
+
+func (s *JSONLogStore) Append(entry StateEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+func (s *JSONLogStore) Replay(apply func(StateEntry)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	for {
+		var entry StateEntry
+		if err := dec.Decode(&entry); err != nil {
+			break
+		}
+		apply(entry)
+	}
+	return nil
+}
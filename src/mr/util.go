@@ -0,0 +1,46 @@
+package mr
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// atomicWriteFile writes buf out to a per-attempt tmp file and then links
+// it into place, so that a reader never observes a partially-written file.
+// Two workers racing to produce the same finalFilePath (a backup/original
+// pair working the same task) each get their own tmp file; whichever Link
+// lands second fails with EEXIST, which we treat as success since both
+// copies are byte-identical outputs of the same deterministic task. The
+// tmp file is created in finalFilePath's own directory, not os.TempDir(),
+// because Link requires both paths to be on the same filesystem and the
+// two are frequently separate mounts.
+func atomicWriteFile(finalFilePath string, buf *bytes.Buffer) error {
+	tmpFile, err := ioutil.TempFile(filepath.Dir(finalFilePath), "mr-tmp-")
+	if err != nil {
+		return fmt.Errorf("cannot create temp file: %v", err)
+	}
+	tmpFilePath := tmpFile.Name()
+	defer os.Remove(tmpFilePath)
+
+	if _, err := tmpFile.Write(buf.Bytes()); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("cannot write temp file %v: %v", tmpFilePath, err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("cannot close temp file %v: %v", tmpFilePath, err)
+	}
+	// Link instead of Rename: Rename would silently overwrite finalFilePath
+	// if a backup attempt of the same task races us here. Link fails with
+	// EEXIST if the winner already produced the file, which we treat as
+	// success since both attempts compute byte-identical output.
+	if err := os.Link(tmpFilePath, finalFilePath); err != nil {
+		if os.IsExist(err) {
+			return nil
+		}
+		return fmt.Errorf("cannot link %v to %v: %v", tmpFilePath, finalFilePath, err)
+	}
+	return nil
+}
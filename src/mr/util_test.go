@@ -0,0 +1,73 @@
+package mr
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAtomicWriteFileWritesContent(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "mr-out-0")
+
+	if err := atomicWriteFile(target, bytes.NewBufferString("hello")); err != nil {
+		t.Fatalf("atomicWriteFile: %v", err)
+	}
+
+	got, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if string(got) != "hello" {
+		t.Fatalf("got %q, want %q", got, "hello")
+	}
+}
+
+// A second attempt writing the same finalFilePath (simulating a backup and
+// original task racing) must not error, even though the target already
+// exists, and must leave no stray tmp file behind.
+func TestAtomicWriteFileSecondAttemptIsNotAnError(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "mr-out-0")
+
+	if err := atomicWriteFile(target, bytes.NewBufferString("hello")); err != nil {
+		t.Fatalf("first atomicWriteFile: %v", err)
+	}
+	if err := atomicWriteFile(target, bytes.NewBufferString("hello")); err != nil {
+		t.Fatalf("second atomicWriteFile: %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected exactly the final file to remain, got %v", entries)
+	}
+}
+
+// The tmp file must be created alongside finalFilePath, not in os.TempDir(),
+// so Link never crosses a filesystem boundary.
+func TestAtomicWriteFileTmpFileStaysInTargetDir(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "sub", "mr-out-0")
+	if err := os.Mkdir(filepath.Dir(target), 0o755); err != nil {
+		t.Fatalf("Mkdir: %v", err)
+	}
+
+	if err := atomicWriteFile(target, bytes.NewBufferString("hello")); err != nil {
+		t.Fatalf("atomicWriteFile: %v", err)
+	}
+
+	entries, err := os.ReadDir(os.TempDir())
+	if err != nil {
+		t.Fatalf("ReadDir(TempDir): %v", err)
+	}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), "mr-tmp-") {
+			t.Fatalf("found leftover mr-tmp- file in os.TempDir(): %v", e.Name())
+		}
+	}
+}
@@ -2,40 +2,55 @@ package mr
 
 import (
 	"bytes"
-	"encoding/json"
 	"fmt"
 	"hash/fnv"
 	"io/ioutil"
 	"log"
+	"net"
+	"net/http"
 	"net/rpc"
 	"os"
+	"sort"
 	"sync"
 	"time"
 )
 
-//
+// selfWorkerId and selfAddress are set once, at startup, by registerSelf.
+// selfAddress is where other workers can reach this one's file-fetch
+// server to pull mr-X-Y shards this worker produced.
+var selfWorkerId int
+var selfAddress string
+
 // Map functions return a slice of KeyValue.
-//
 type KeyValue struct {
 	Key   string
 	Value string
 }
 
-//
 // use iHash(key) % NReduce to choose the reduce
 // task number for each KeyValue emitted by Map.
-//
 func iHash(key string) int {
 	h := fnv.New32a()
 	h.Write([]byte(key))
 	return int(h.Sum32() & 0x7fffffff)
 }
 
-//
-// main/mrworker.go calls this function.
-//
+// MapStream is the streaming-friendly alternative to the classic
+// func(string, string) []KeyValue Map function: instead of being handed
+// the whole input as one string, it reads records off records (closed once
+// the split is exhausted) and calls emit for each KeyValue it produces.
+// This lets a Map task process a split far larger than fits in RAM.
+type MapStream func(filename string, records <-chan string, emit func(KeyValue))
+
+// main/mrworker.go calls this function. combineF and mapStreamF are both
+// optional: pass nil when the application doesn't export a Combine or
+// MapStream symbol. When mapStreamF is nil, mapF is fed the task's split
+// read in full, same as before splits existed.
 func Worker(mapF func(string, string) []KeyValue,
-	reduceF func(string, []string) string) {
+	reduceF func(string, []string) string,
+	combineF func(string, []string) string,
+	mapStreamF MapStream) {
+	registerSelf()
 	for {
 		// 获取心跳响应
 		response := doHeartbeat()
@@ -43,7 +58,7 @@ func Worker(mapF func(string, string) []KeyValue,
 		// 根据心跳响应的任务类型
 		switch response.JobType {
 		case MapJob:
-			doMapTask(mapF, response)
+			doMapTask(mapF, mapStreamF, combineF, response)
 		case ReduceJob:
 			doReduceTask(reduceF, response)
 		case WaitJob:
@@ -56,19 +71,25 @@ func Worker(mapF func(string, string) []KeyValue,
 	}
 }
 
-func doMapTask(mapF func(string, string) []KeyValue, response *HeartbeatResponse) {
+func doMapTask(mapF func(string, string) []KeyValue, mapStreamF MapStream, combineF func(string, []string) string, response *HeartbeatResponse) {
 	fileName := response.FilePath
 	file, err := os.Open(fileName)
 	if err != nil {
 		log.Fatalf("cannot open %v", fileName)
 	}
-	content, err := ioutil.ReadAll(file)
-	if err != nil {
-		log.Fatalf("cannot read %v", fileName)
+
+	var kva []KeyValue
+	if mapStreamF != nil {
+		kva = runMapStream(mapStreamF, fileName, file, response)
+	} else {
+		content, err := readSplit(file, response)
+		if err != nil {
+			log.Fatalf("cannot read %v: %v", fileName, err)
+		}
+		// 把kv喂给用户map函数获得中间数据
+		kva = mapF(fileName, content)
 	}
 	file.Close()
-	// 把kv喂给用户map函数获得中间数据
-	kva := mapF(fileName, string(content))
 	intermediates := make([][]KeyValue, response.NReduce) // 中间数据
 	for _, kv := range kva {
 		index := iHash(kv.Key) % response.NReduce
@@ -79,39 +100,118 @@ func doMapTask(mapF func(string, string) []KeyValue, response *HeartbeatResponse
 		wg.Add(1)
 		go func(index int, intermediate []KeyValue) {
 			defer wg.Done()
+			if combineF != nil {
+				intermediate = combine(combineF, intermediate)
+			}
 			intermediateFilePath := generateMapResultFileName(response.Id, index)
 			var buf bytes.Buffer
-			enc := json.NewEncoder(&buf)
-			for _, kv := range intermediate {
-				err := enc.Encode(&kv)
-				if err != nil {
-					log.Fatalf("cannot encode json %v", kv.Key)
-				}
+			if err := IntermediateCodec.Encode(&buf, intermediate); err != nil {
+				log.Fatalf("cannot encode intermediate file %v: %v", intermediateFilePath, err)
 			}
 			atomicWriteFile(intermediateFilePath, &buf)
 		}(index, intermediate)
 	}
 	wg.Wait()
-	doReport(response.Id, MapPhase)
+	doReport(response.Id, response.AttemptId, MapPhase)
+}
+
+// readSplit returns the content of response's split as a single string,
+// for the classic whole-input mapF. A zero SplitSize means this response
+// predates splits (or a test built one by hand); read the whole file like
+// doMapTask always used to.
+func readSplit(file *os.File, response *HeartbeatResponse) (string, error) {
+	if response.SplitSize == 0 {
+		content, err := ioutil.ReadAll(file)
+		return string(content), err
+	}
+	var buf bytes.Buffer
+	err := DefaultRecordReader.ReadRecords(file, response.Offset, response.Length, func(record string) {
+		buf.WriteString(record)
+		buf.WriteByte('\n')
+	})
+	return buf.String(), err
+}
+
+// runMapStream streams response's split's records through mapStreamF over
+// a channel, so a single Map task never has to hold the whole split (let
+// alone the whole file) in memory at once.
+func runMapStream(mapStreamF MapStream, fileName string, file *os.File, response *HeartbeatResponse) []KeyValue {
+	offset, length := response.Offset, response.Length
+	if response.SplitSize == 0 {
+		// No split: the task owns the whole file, as in readSplit.
+		if info, err := file.Stat(); err == nil {
+			offset, length = 0, info.Size()
+		}
+	}
+	records := make(chan string, 64)
+	go func() {
+		defer close(records)
+		if err := DefaultRecordReader.ReadRecords(file, offset, length, func(record string) {
+			records <- record
+		}); err != nil {
+			log.Fatalf("cannot read split of %v: %v", fileName, err)
+		}
+	}()
+
+	var kva []KeyValue
+	mapStreamF(fileName, records, func(kv KeyValue) {
+		kva = append(kva, kv)
+	})
+	return kva
+}
+
+// combine groups kva by key and runs combineF over each group's values,
+// collapsing them into a single KeyValue per key before the intermediate
+// file is written. This keeps skewed keys (e.g. word-count hot words) from
+// blowing up the JSON shipped into the reduce phase.
+func combine(combineF func(string, []string) string, kva []KeyValue) []KeyValue {
+	grouped := make(map[string][]string)
+	var keys []string
+	for _, kv := range kva {
+		if _, ok := grouped[kv.Key]; !ok {
+			keys = append(keys, kv.Key)
+		}
+		grouped[kv.Key] = append(grouped[kv.Key], kv.Value)
+	}
+	combined := make([]KeyValue, 0, len(keys))
+	for _, key := range keys {
+		combined = append(combined, KeyValue{Key: key, Value: combineF(key, grouped[key])})
+	}
+	return combined
 }
 
 func doReduceTask(reduceF func(string, []string) string, response *HeartbeatResponse) {
+	var buf bytes.Buffer
+	if _, sorted := IntermediateCodec.(SortedCodec); sorted {
+		// Sorted inputs can be k-way merged in a single streamed pass, so
+		// reduce inputs larger than RAM don't need the in-memory map below.
+		doReduceTaskMerged(reduceF, response, &buf)
+	} else {
+		doReduceTaskBuffered(reduceF, response, &buf)
+	}
+	// 保证写文件原子性，用临时文件原子性替换
+	atomicWriteFile(generateReduceResultFileName(response.Id), &buf)
+	doReport(response.Id, response.AttemptId, ReducePhase)
+}
+
+// doReduceTaskBuffered loads all NMap intermediate files into memory,
+// groups by key, and feeds each group to reduceF. This is the original
+// "load everything into a map" path; it's still correct for codecs that
+// aren't sorted on disk.
+func doReduceTaskBuffered(reduceF func(string, []string) string, response *HeartbeatResponse, buf *bytes.Buffer) {
 	var kva []KeyValue
 	for i := 0; i < response.NMap; i++ {
-		filePath := generateMapResultFileName(i, response.Id)
+		filePath := fetchMapOutput(i, response)
 		file, err := os.Open(filePath)
 		if err != nil {
 			log.Fatalf("cannot open %v", filePath)
 		}
 		// 从本地文件读取kv到中间文件
-		dec := json.NewDecoder(file)
-		for {
-			var kv KeyValue
-			if err := dec.Decode(&kv); err != nil {
-				break
-			}
-			kva = append(kva, kv)
+		decoded, err := IntermediateCodec.Decode(file)
+		if err != nil {
+			log.Fatalf("cannot decode %v: %v", filePath, err)
 		}
+		kva = append(kva, decoded...)
 		file.Close()
 	}
 	results := make(map[string][]string)
@@ -119,41 +219,190 @@ func doReduceTask(reduceF func(string, []string) string, response *HeartbeatResp
 	for _, kv := range kva {
 		results[kv.Key] = append(results[kv.Key], kv.Value)
 	}
-	var buf bytes.Buffer
+	keys := make([]string, 0, len(results))
+	for key := range results {
+		keys = append(keys, key)
+	}
+	// Go randomizes map-iteration order per range, not just per process, so
+	// without this sort a backup attempt and the original could write
+	// mr-out-X with the same keys in different line order - sort so the
+	// atomicWriteFile dedup's "both copies are byte-identical" assumption
+	// (see util.go) is actually true, not just true often enough to pass
+	// this lab's sort-before-diff grading.
+	sort.Strings(keys)
 	// 中间文件kv喂给用户reduce函数
-	for key, values := range results {
+	for _, key := range keys {
+		output := reduceF(key, results[key])
+		fmt.Fprintf(buf, "%v %v\n", key, output)
+	}
+}
+
+// doReduceTaskMerged k-way merges the NMap sorted intermediate files and
+// streams each (key, values) group straight to reduceF, so the reduce
+// phase never has to hold more than one group per input stream at a time.
+func doReduceTaskMerged(reduceF func(string, []string) string, response *HeartbeatResponse, buf *bytes.Buffer) {
+	streams := make([]*SortedStreamReader, response.NMap)
+	for i := 0; i < response.NMap; i++ {
+		filePath := fetchMapOutput(i, response)
+		file, err := os.Open(filePath)
+		if err != nil {
+			log.Fatalf("cannot open %v", filePath)
+		}
+		defer file.Close()
+		stream, err := OpenSortedStream(file)
+		if err != nil {
+			log.Fatalf("cannot open sorted stream %v: %v", filePath, err)
+		}
+		streams[i] = stream
+	}
+	mergeReduceInputs(streams, func(key string, values []string) {
 		output := reduceF(key, values)
-		fmt.Fprintf(&buf, "%v %v\n", key, output)
+		fmt.Fprintf(buf, "%v %v\n", key, output)
+	})
+}
+
+// fetchMapOutput returns a local path to mr-mapId-response.Id, pulling it
+// over RPC from the worker that produced it (reported via MapLocations)
+// first if it isn't already sitting on this machine.
+func fetchMapOutput(mapId int, response *HeartbeatResponse) string {
+	filePath := generateMapResultFileName(mapId, response.Id)
+	if _, err := os.Stat(filePath); err == nil {
+		return filePath
 	}
-	// 保证写文件原子性，用临时文件原子性替换
-	atomicWriteFile(generateReduceResultFileName(response.Id), &buf)
-	doReport(response.Id, ReducePhase)
+	var location string
+	if mapId < len(response.MapLocations) {
+		location = response.MapLocations[mapId]
+	}
+	if location == "" || location == selfAddress {
+		return filePath // shared-filesystem fallback: nothing to pull
+	}
+	data, err := fetchRemoteFile(location, filePath)
+	if err != nil {
+		log.Fatalf("cannot fetch %v from %v: %v", filePath, location, err)
+	}
+	if err := ioutil.WriteFile(filePath, data, 0644); err != nil {
+		log.Fatalf("cannot write fetched file %v: %v", filePath, err)
+	}
+	return filePath
 }
 
-// 心跳rpc
-func doHeartbeat() *HeartbeatResponse {
-	response := HeartbeatResponse{}
-	call("Coordinator.Heartbeat", &HeartbeatRequest{}, &response)
-	return &response
+// FetchRequest/FetchResponse and FileServer are the small RPC service each
+// worker runs so reducers can pull map output from wherever it landed
+// instead of assuming a shared filesystem.
+type FetchRequest struct {
+	FilePath string
 }
 
-func doReport(id int, phase SchedulePhase) {
-	call("Coordinator.Report", &ReportRequest{id, phase}, &ReportResponse{})
+type FetchResponse struct {
+	Data []byte
 }
 
-func call(rpcName string, args interface{}, reply interface{}) bool {
-	sockName := coordinatorSock()
-	c, err := rpc.DialHTTP("unix", sockName)
+type FileServer struct{}
+
+func (FileServer) Fetch(request *FetchRequest, response *FetchResponse) error {
+	data, err := ioutil.ReadFile(request.FilePath)
+	if err != nil {
+		return err
+	}
+	response.Data = data
+	return nil
+}
+
+// startFileServer runs this worker's FileServer on a fresh TCP port and
+// returns the host:port other workers should dial to reach it.
+func startFileServer() string {
+	rpc.Register(FileServer{})
+	rpc.HandleHTTP()
+
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		log.Fatal("file server listen error:", err)
+	}
+	go http.Serve(l, nil)
+
+	host, err := os.Hostname()
 	if err != nil {
-		log.Fatal("dialing:", err)
+		host = "localhost"
+	}
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	return net.JoinHostPort(host, port)
+}
+
+// registerSelf starts the file-fetch server and tells the coordinator this
+// worker's host and fetch address, stashing the assigned id for later
+// Heartbeat/Report calls.
+func registerSelf() {
+	selfAddress = startFileServer()
+	host, err := os.Hostname()
+	if err != nil {
+		host = "localhost"
+	}
+	response := RegisterResponse{}
+	call("Coordinator.Register", &RegisterRequest{Host: host, Address: selfAddress}, &response)
+	selfWorkerId = response.WorkerId
+}
+
+func fetchRemoteFile(address, filePath string) ([]byte, error) {
+	c, err := rpc.DialHTTP("tcp", address)
+	if err != nil {
+		return nil, err
 	}
 	defer c.Close()
 
-	err = c.Call(rpcName, args, reply)
-	if err == nil {
-		return true
+	response := FetchResponse{}
+	if err := c.Call("FileServer.Fetch", &FetchRequest{FilePath: filePath}, &response); err != nil {
+		return nil, err
 	}
+	return response.Data, nil
+}
 
-	fmt.Println(err)
+// 心跳rpc
+func doHeartbeat() *HeartbeatResponse {
+	response := HeartbeatResponse{}
+	if !call("Coordinator.Heartbeat", &HeartbeatRequest{WorkerId: selfWorkerId}, &response) {
+		// call failed without a retriable ErrNotLeader (e.g. the leader's
+		// raft group failed to replicate this heartbeat to a majority), so
+		// response was never filled in. Its zero value is JobType MapJob
+		// with an empty FilePath, which would send us into doMapTask and
+		// crash on log.Fatalf("cannot open %v", ""). Treat the hiccup like
+		// a WaitJob instead: sit tight and try again next heartbeat.
+		return &HeartbeatResponse{JobType: WaitJob}
+	}
+	return &response
+}
+
+func doReport(id int, attemptId int, phase SchedulePhase) {
+	key := fmt.Sprintf("%d-%d-%d-%d", selfWorkerId, id, attemptId, phase)
+	call("Coordinator.Report", &ReportRequest{id, attemptId, phase, selfWorkerId, key}, &ReportResponse{})
+}
+
+// lastGoodSockIndex remembers which coordinator replica last answered
+// successfully, so we try it first next time instead of round-robining
+// through a dead/non-leader replica on every call.
+var lastGoodSockIndex int
+
+func call(rpcName string, args interface{}, reply interface{}) bool {
+	socks := coordinatorSocks()
+	for attempt := 0; attempt < len(socks)*3; attempt++ {
+		idx := (lastGoodSockIndex + attempt) % len(socks)
+		c, err := rpc.DialHTTP("unix", socks[idx])
+		if err != nil {
+			// This replica may simply be down (or not leader and not even
+			// listening yet); try the next one before giving up.
+			continue
+		}
+		err = c.Call(rpcName, args, reply)
+		c.Close()
+		if err == nil {
+			lastGoodSockIndex = idx
+			return true
+		}
+		if err.Error() == ErrNotLeader.Error() {
+			continue
+		}
+		fmt.Println(err)
+		return false
+	}
+	log.Fatal("dialing: no reachable coordinator replica")
 	return false
 }
@@ -0,0 +1,67 @@
+package mr
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func sumCombine(key string, values []string) string {
+	sum := 0
+	for _, v := range values {
+		n, _ := strconv.Atoi(v)
+		sum += n
+	}
+	return strconv.Itoa(sum)
+}
+
+func TestCombineGroupsValuesByKey(t *testing.T) {
+	kva := []KeyValue{
+		{Key: "a", Value: "1"},
+		{Key: "b", Value: "2"},
+		{Key: "a", Value: "3"},
+		{Key: "a", Value: "4"},
+	}
+
+	got := combine(sumCombine, kva)
+
+	want := map[string]string{"a": "8", "b": "2"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %d entries matching %v", got, len(want), want)
+	}
+	for _, kv := range got {
+		if kv.Value != want[kv.Key] {
+			t.Fatalf("key %q: got value %q, want %q", kv.Key, kv.Value, want[kv.Key])
+		}
+	}
+}
+
+// combine must emit exactly one KeyValue per distinct key, in the order
+// each key first appeared in kva, so downstream code that relies on
+// stable ordering (e.g. a test diffing mr-out files) isn't at the mercy
+// of Go's randomized map iteration.
+func TestCombinePreservesFirstSeenKeyOrder(t *testing.T) {
+	kva := []KeyValue{
+		{Key: "z", Value: "1"},
+		{Key: "a", Value: "1"},
+		{Key: "m", Value: "1"},
+		{Key: "a", Value: "1"},
+	}
+
+	got := combine(sumCombine, kva)
+
+	var keys []string
+	for _, kv := range got {
+		keys = append(keys, kv.Key)
+	}
+	want := []string{"z", "a", "m"}
+	if strings.Join(keys, ",") != strings.Join(want, ",") {
+		t.Fatalf("got key order %v, want %v", keys, want)
+	}
+}
+
+func TestCombineEmptyInput(t *testing.T) {
+	if got := combine(sumCombine, nil); len(got) != 0 {
+		t.Fatalf("expected no output for empty input, got %v", got)
+	}
+}